@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// backupFile is the on-disk format written by writeBackup. It records which
+// Codec produced the live entry alongside the entry itself, so restore can
+// target the same physical (codec-suffixed) key instead of guessing - this
+// matters whenever the entry wasn't fetched with the gzip default, e.g. under
+// -compression auto.
+type backupFile struct {
+	Codec string                  `json:"codec"`
+	Entry *CachedManifestResponse `json:"entry"`
+}
+
+// writeBackup serializes the original, unmodified CachedManifestResponse
+// (with its original CacheEntryHash intact) to path so the entry can be
+// restored later with -mode restore.
+func writeBackup(path string, codec Codec, cmr *CachedManifestResponse) error {
+	data, err := json.MarshalIndent(backupFile{Codec: codec.Name(), Entry: cmr}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal backup: %w", err)
+	}
+	return os.WriteFile(path, data, 0o600)
+}
+
+// runRestore reads a backup produced by writeBackup and writes it back to key
+// using the codec recorded in the backup, re-establishing the pre-attack
+// state under the same physical key the live entry was read from.
+func runRestore(rediscache *redisCache, keyFilePath, backupFilePath string) error {
+	if keyFilePath == "" || backupFilePath == "" {
+		flag.Usage()
+		return fmt.Errorf("both -key and -backup flags are required for -mode restore")
+	}
+
+	keyData, err := os.ReadFile(keyFilePath)
+	if err != nil {
+		return fmt.Errorf("error reading key file: %w", err)
+	}
+	key := strings.TrimSpace(string(keyData))
+
+	backupData, err := os.ReadFile(backupFilePath)
+	if err != nil {
+		return fmt.Errorf("error reading backup file: %w", err)
+	}
+
+	var backup backupFile
+	if err := json.Unmarshal(backupData, &backup); err != nil {
+		return fmt.Errorf("error decoding backup file: %w", err)
+	}
+
+	codec, err := lookupCodec(backup.Codec)
+	if err != nil {
+		return fmt.Errorf("error resolving backup codec: %w", err)
+	}
+
+	if err := rediscache.Set(key, backup.Entry, codec); err != nil {
+		return fmt.Errorf("error restoring cached manifest: %w", err)
+	}
+
+	fmt.Printf("\n\nRestored original cached manifest for key %s\n\n", key)
+	return nil
+}
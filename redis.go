@@ -0,0 +1,120 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// redisFlags collects the raw flag.String/flag.Bool values needed to build a
+// redis.UniversalClient, so they can be parsed once in main and handed off
+// to newUniversalClient.
+type redisFlags struct {
+	addr               string
+	db                 int
+	password           string
+	passwordFile       string
+	sentinelMaster     string
+	sentinelAddrs      string
+	cluster            bool
+	tls                bool
+	caFile             string
+	certFile           string
+	keyFile            string
+	insecureSkipVerify bool
+}
+
+// newUniversalClient builds a redis.UniversalClient from the given flags,
+// picking standalone, Sentinel, or Cluster mode depending on which flags were
+// set.
+func newUniversalClient(f redisFlags) (redis.UniversalClient, error) {
+	password, err := resolveRedisPassword(f.password, f.passwordFile)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := &redis.UniversalOptions{
+		DB:       f.db,
+		Password: password,
+	}
+
+	switch {
+	case f.sentinelAddrs != "":
+		if f.sentinelMaster == "" {
+			return nil, fmt.Errorf("-redis-sentinel-master is required when -redis-sentinel-addrs is set")
+		}
+		opts.Addrs = splitAddrs(f.sentinelAddrs)
+		opts.MasterName = f.sentinelMaster
+	case f.cluster:
+		opts.Addrs = splitAddrs(f.addr)
+		// IsClusterMode forces cluster mode even with a single address, e.g.
+		// an ElastiCache cluster configuration endpoint. Without it,
+		// NewUniversalClient falls back to a standalone client whenever
+		// len(Addrs) == 1.
+		opts.IsClusterMode = true
+	default:
+		opts.Addrs = []string{f.addr}
+	}
+
+	if f.tls {
+		tlsConfig, err := buildRedisTLSConfig(f.caFile, f.certFile, f.keyFile, f.insecureSkipVerify)
+		if err != nil {
+			return nil, fmt.Errorf("failed to build redis TLS config: %w", err)
+		}
+		opts.TLSConfig = tlsConfig
+	}
+
+	return redis.NewUniversalClient(opts), nil
+}
+
+func splitAddrs(addrs string) []string {
+	parts := strings.Split(addrs, ",")
+	out := make([]string, 0, len(parts))
+	for _, p := range parts {
+		if p = strings.TrimSpace(p); p != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+func resolveRedisPassword(password, passwordFile string) (string, error) {
+	if passwordFile == "" {
+		return password, nil
+	}
+	data, err := os.ReadFile(passwordFile)
+	if err != nil {
+		return "", fmt.Errorf("failed to read -redis-password-file: %w", err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+func buildRedisTLSConfig(caFile, certFile, keyFile string, insecureSkipVerify bool) (*tls.Config, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: insecureSkipVerify}
+
+	if caFile != "" {
+		caCert, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read -redis-ca-file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caCert) {
+			return nil, fmt.Errorf("failed to parse CA certificate from -redis-ca-file")
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load -redis-cert-file/-redis-key-file: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}